@@ -0,0 +1,67 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// CRDSchema validates a JSON-encoded resource against a single CRD version's OpenAPI schema.
+type CRDSchema struct {
+	validator *validation.SchemaValidator
+}
+
+// LoadCRDSchema loads the CRD manifest at path and returns a CRDSchema that validates
+// against the OpenAPI schema of the first version listed in the manifest. Other versions
+// are ignored, and whether that first version is served is not checked.
+func LoadCRDSchema(path string) (*CRDSchema, error) {
+	bin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading CRD manifest %q", path)
+	}
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := yaml.Unmarshal(bin, &crd); err != nil {
+		return nil, errors.Wrapf(err, "parsing CRD manifest %q", path)
+	}
+
+	if len(crd.Spec.Versions) == 0 {
+		return nil, errors.Errorf("CRD manifest %q has no versions", path)
+	}
+
+	var internalSchema apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(crd.Spec.Versions[0].Schema.OpenAPIV3Schema, &internalSchema, nil); err != nil {
+		return nil, errors.Wrapf(err, "converting CRD schema %q", path)
+	}
+
+	validator, _, err := validation.NewSchemaValidator(&internalSchema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "building schema validator for %q", path)
+	}
+
+	return &CRDSchema{validator: validator}, nil
+}
+
+// Validate checks that bin (a JSON-encoded resource) conforms to this CRD version's schema.
+func (s *CRDSchema) Validate(bin []byte) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(bin, &obj); err != nil {
+		return errors.Wrap(err, "unmarshalling resource for schema validation")
+	}
+
+	if result := validation.ValidateCustomResource(nil, obj, s.validator); len(result) > 0 {
+		return result.ToAggregate()
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/dnaeon/go-vcr/recorder"
+)
+
+// DeterministicRand returns an io.Reader for use anywhere a test currently reads from
+// crypto/rand - SSH key generation, resource-name suffixes, UUID minting, and so on. When
+// recording or replaying, it's seeded by SHA-256 of the test's name (plus a per-call
+// counter); since recorded cassettes already scrub these values on save, giving them a
+// stable source means re-recording an otherwise-unchanged test produces a zero-line
+// cassette diff instead of incidental churn on every run. Live mode (AzureClientRecorder
+// disabled) continues to use crypto/rand, since there's no cassette diff to stabilize.
+func (tc PerTestContext) DeterministicRand() io.Reader {
+	return chooseRandReader(tc.AzureClientRecorder.Mode(), tc.TestName, tc.randCallCount)
+}
+
+func newDeterministicRand(testName string, callCount *uint64) io.Reader {
+	call := atomic.AddUint64(callCount, 1)
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", testName, call)))
+
+	return &seededReader{seed: seed[:]}
+}
+
+// chooseRandReader picks the right entropy source for a test: deterministic, so that
+// re-recording an unchanged test produces a zero-line cassette diff, unless the recorder
+// is disabled (talking to Azure directly with no cassette), in which case real randomness
+// is used as normal.
+func chooseRandReader(mode recorder.Mode, testName string, callCount *uint64) io.Reader {
+	if mode == recorder.ModeDisabled {
+		return cryptorand.Reader
+	}
+
+	return newDeterministicRand(testName, callCount)
+}
+
+// seededReader is an unbounded deterministic byte stream: each 32-byte block is the
+// SHA-256 hash of the seed followed by that block's own index, so callers that need
+// more entropy than a single hash's worth (e.g. rsa.GenerateKey) never run dry.
+type seededReader struct {
+	seed  []byte
+	block uint64
+	buf   []byte
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			h := sha256.Sum256(append(r.seed, byte(r.block), byte(r.block>>8), byte(r.block>>16), byte(r.block>>24)))
+			r.buf = h[:]
+			r.block++
+		}
+
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+
+	return n, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dnaeon/go-vcr/recorder"
+)
+
+func TestNewDeterministicRand_IsDeterministicPerCall(t *testing.T) {
+	t.Parallel()
+
+	callCountA := new(uint64)
+	a := newDeterministicRand("TestSomething", callCountA)
+	bufA := make([]byte, 64)
+	if _, err := io.ReadFull(a, bufA); err != nil {
+		t.Fatalf("reading from first reader: %s", err)
+	}
+
+	callCountB := new(uint64)
+	b := newDeterministicRand("TestSomething", callCountB)
+	bufB := make([]byte, 64)
+	if _, err := io.ReadFull(b, bufB); err != nil {
+		t.Fatalf("reading from second reader: %s", err)
+	}
+
+	if !bytes.Equal(bufA, bufB) {
+		t.Fatal("expected two readers built from the same test name and call count to produce identical output")
+	}
+
+	callCountC := new(uint64)
+	_ = newDeterministicRand("TestSomething", callCountC) // call 1, consumed
+	c := newDeterministicRand("TestSomething", callCountC) // call 2
+	bufC := make([]byte, 64)
+	if _, err := io.ReadFull(c, bufC); err != nil {
+		t.Fatalf("reading from third reader: %s", err)
+	}
+
+	if bytes.Equal(bufA, bufC) {
+		t.Fatal("expected a later call count for the same test to produce different output")
+	}
+}
+
+func TestChooseRandReader_DisabledModeIsNotDeterministic(t *testing.T) {
+	t.Parallel()
+
+	callCount := new(uint64)
+	reader := chooseRandReader(recorder.ModeDisabled, "TestSomething", callCount)
+
+	buf := make([]byte, 64)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("reading from disabled-mode reader: %s", err)
+	}
+
+	// a real crypto/rand.Reader should never produce an all-zero buffer for 64 bytes
+	if bytes.Equal(buf, make([]byte, 64)) {
+		t.Fatal("expected live-mode randomness, got an all-zero buffer")
+	}
+
+	// the same test name and call count would give exactly this output in record/replay mode
+	seeded := make([]byte, 64)
+	if _, err := io.ReadFull(newDeterministicRand("TestSomething", new(uint64)), seeded); err != nil {
+		t.Fatalf("reading from seeded reader: %s", err)
+	}
+
+	if bytes.Equal(buf, seeded) {
+		t.Fatal("expected disabled mode not to use the test-name-seeded reader")
+	}
+}
+
+func TestReaderSource_Int63IsDeterministic(t *testing.T) {
+	t.Parallel()
+
+	a := &readerSource{reader: newDeterministicRand("TestSomething", new(uint64))}
+	b := &readerSource{reader: newDeterministicRand("TestSomething", new(uint64))}
+
+	for i := 0; i < 4; i++ {
+		if a.Int63() != b.Int63() {
+			t.Fatalf("expected identical readerSources to produce identical Int63 sequences at index %d", i)
+		}
+	}
+}
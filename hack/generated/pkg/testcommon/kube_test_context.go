@@ -0,0 +1,55 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/azure-service-operator/hack/generated/controllers"
+)
+
+// KubeBaseTestContext is the envtest-backed Kubernetes test context: a full
+// etcd+apiserver+webhook environment, reachable via KubeConfig.
+type KubeBaseTestContext struct {
+	PerTestContext
+	KubeConfig *rest.Config
+}
+
+// KubeTestContext is satisfied by every flavor of Kubernetes-side test context
+// (envtest-backed and fake-client-backed), so a test can pick its flavor via
+// TestContext.KubeTestMode and still get back a client.Client to drive the test with.
+type KubeTestContext interface {
+	GetClient() (client.Client, error)
+}
+
+// GetClient returns a client.Client talking to the envtest environment's apiserver.
+func (k *KubeBaseTestContext) GetClient() (client.Client, error) {
+	return client.New(k.KubeConfig, client.Options{Scheme: controllers.CreateScheme()})
+}
+
+// GetClient returns the fake client reconcilers were registered against.
+func (k *FakeKubeTestContext) GetClient() (client.Client, error) {
+	return k.KubeClient, nil
+}
+
+// CreateKubeTestContext creates the Kubernetes-side test context selected by
+// tc.KubeTestMode:
+//   - ModeEnvtest (the default) spins up a full etcd+apiserver+webhook environment -
+//     use it for CRD validation and webhook tests.
+//   - ModeFake runs reconcilers directly against a controller-runtime fake client -
+//     use it for sub-second reconciler-logic tests that don't need CRD/webhook coverage.
+func (tc PerTestContext) CreateKubeTestContext() (KubeTestContext, error) {
+	switch tc.KubeTestMode {
+	case ModeFake:
+		return createFakeClientContext(tc)
+	case ModeEnvtest, "":
+		return createEnvtestContext(tc)
+	default:
+		return nil, errors.Errorf("KubeTestMode %q is not supported by CreateKubeTestContext", tc.KubeTestMode)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// ResourceNameConfig describes how generated test resource names are shaped: a fixed
+// prefix (so they're easy to find and clean up), a separator, and the length of the
+// random suffix appended to keep names from colliding across concurrent test runs.
+type ResourceNameConfig struct {
+	prefix       string
+	separator    string
+	randomLength int
+}
+
+// NewResourceNameConfig creates a new ResourceNameConfig.
+func NewResourceNameConfig(prefix string, separator string, randomLength int) *ResourceNameConfig {
+	return &ResourceNameConfig{
+		prefix:       prefix,
+		separator:    separator,
+		randomLength: randomLength,
+	}
+}
+
+// ResourceNamer generates Kubernetes/Azure resource names for a single test.
+type ResourceNamer interface {
+	GenerateName(kind string) string
+}
+
+type resourceNamer struct {
+	config *ResourceNameConfig
+	rand   *rand.Rand
+}
+
+// NewResourceNamer creates a ResourceNamer for testName, drawing its random suffixes
+// from randReader. Callers should pass a PerTestContext.DeterministicRand() while
+// recording/replaying so that re-recording an unchanged test doesn't also churn
+// resource names, and crypto/rand.Reader for live runs against a real cluster.
+func (c *ResourceNameConfig) NewResourceNamer(testName string, randReader io.Reader) ResourceNamer {
+	return &resourceNamer{
+		config: c,
+		rand:   rand.New(&readerSource{reader: randReader}),
+	}
+}
+
+// GenerateName returns a new name of the form "<prefix><separator><kind><separator><random suffix>".
+func (n *resourceNamer) GenerateName(kind string) string {
+	parts := []string{n.config.prefix, kind, n.randomSuffix()}
+	return strings.Join(parts, n.config.separator)
+}
+
+const nameSuffixAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func (n *resourceNamer) randomSuffix() string {
+	result := make([]byte, n.config.randomLength)
+	for i := range result {
+		result[i] = nameSuffixAlphabet[n.rand.Intn(len(nameSuffixAlphabet))]
+	}
+
+	return string(result)
+}
+
+// readerSource adapts an io.Reader into a math/rand.Source, so a ResourceNamer can draw
+// its randomness from the same deterministic (or live) source as the rest of the test.
+type readerSource struct {
+	reader io.Reader
+}
+
+func (s *readerSource) Int63() int64 {
+	var buf [8]byte
+	// a seededReader/crypto/rand.Reader never returns an error worth handling here -
+	// the same assumption the stdlib's own crypto/rand-backed rand.Source makes
+	_, _ = io.ReadFull(s.reader, buf[:])
+
+	return int64(binary.BigEndian.Uint64(buf[:]) &^ (1 << 63))
+}
+
+func (s *readerSource) Seed(int64) {
+	// no-op: the entropy source is fixed at construction time
+}
@@ -0,0 +1,235 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Sanitizer scrubs sensitive or noisy data out of recorded cassettes. Each
+// implementation registers one of the test-proxy's built-in sanitizer kinds
+// against a running recording session.
+type Sanitizer interface {
+	// register installs this rule against the given recording/playback session.
+	register(proxyAddress string, recordingID string, client *http.Client) error
+}
+
+// SanitizerRegistry holds the set of Sanitizers that should be applied to every
+// recording made through a TestContext. Tests can add resource-specific rules
+// on top of the default set with tc.Sanitizers.Add(...) before calling ForTest.
+type SanitizerRegistry struct {
+	sanitizers []Sanitizer
+}
+
+// NewDefaultSanitizerRegistry returns a registry pre-populated with the rules
+// needed to keep well-known Azure secret shapes out of cassettes: storage
+// account keys, SQL passwords, KeyVault secret payloads, SAS tokens, and
+// similar. Newly generated ARM resource types get this coverage for free.
+func NewDefaultSanitizerRegistry() *SanitizerRegistry {
+	registry := &SanitizerRegistry{}
+
+	registry.Add(
+		// storage account / cosmos / redis-style keys
+		NewBodyKeyReplacer("$..primaryKey", "{KEY}"),
+		NewBodyKeyReplacer("$..secondaryKey", "{KEY}"),
+		NewBodyKeyReplacer("$..storageAccountKey", "{KEY}"),
+		NewBodyKeyReplacer("$..connectionString", "{CONNECTION_STRING}"),
+		NewBodyKeyReplacer("$..password", "{PASSWORD}"),
+		NewBodyKeyReplacer("$..certificate", "{CERTIFICATE}"),
+
+		// KeyVault get-secret response payload - scoped to that one operation's URL since
+		// "value" is far too generic a key to sanitize everywhere (ARM's standard
+		// paginated List response is shaped {"value": [...], "nextLink": ...}, and a
+		// blanket $..value would stomp that array in every recorded List call)
+		NewScopedBodyKeyReplacer("$..value", "{SECRET}", `/secrets/[^/]+(/[0-9a-f]+)?$`),
+
+		// SAS tokens and resource/tenant IDs embedded in URLs
+		NewURIRegexSanitizer(`sig=[^&]+`, "sig={SAS_SIGNATURE}"),
+		NewURIRegexSanitizer(`/subscriptions/[0-9a-fA-F-]+`, "/subscriptions/00000000-0000-0000-0000-000000000000"),
+		NewURIRegexSanitizer(`/tenants/[0-9a-fA-F-]+`, "/tenants/00000000-0000-0000-0000-000000000000"),
+
+		// the same resource/tenant IDs also show up embedded in response/request bodies
+		// (e.g. every resource's "id" field) - without this, real subscription IDs leak
+		// into cassette bodies, and replay body-matching breaks for any call whose body
+		// contains one, since the cassette keeps the real GUID but a replaying request is
+		// built with uuid.Nil
+		NewBodyRegexSanitizer(`/subscriptions/[0-9a-fA-F-]+`, "/subscriptions/00000000-0000-0000-0000-000000000000"),
+		NewBodyRegexSanitizer(`/tenants/[0-9a-fA-F-]+`, "/tenants/00000000-0000-0000-0000-000000000000"),
+
+		// dates and SSH keys so unchanged tests re-record with a zero-line diff
+		NewBodyRegexSanitizer(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?Z`, "2001-02-03T04:05:06Z"),
+		NewBodyRegexSanitizer(`ssh-rsa [0-9a-zA-Z+/=]+`, "ssh-rsa {KEY}"),
+
+		NewHeaderRegexSanitizer("Ocp-Apim-Subscription-Key", `.+`, "{SUBSCRIPTION_KEY}"),
+		NewHeaderRegexSanitizer("x-ms-encryption-key", `.+`, "{ENCRYPTION_KEY}"),
+
+		NewHeaderRemover("Authorization"),
+		NewHeaderRemover("User-Agent"),
+		NewHeaderRemover("X-Ms-Correlation-Request-Id"),
+		NewHeaderRemover("X-Ms-Ratelimit-Remaining-Subscription-Reads"),
+		NewHeaderRemover("X-Ms-Ratelimit-Remaining-Subscription-Writes"),
+		NewHeaderRemover("X-Ms-Request-Id"),
+		NewHeaderRemover("X-Ms-Routing-Request-Id"),
+	)
+
+	return registry
+}
+
+// Add registers additional Sanitizers to run for every test using this registry.
+// Call this from an individual test, before ForTest, to add per-resource rules
+// (e.g. a newly generated resource type with a secret field the defaults don't know about).
+func (r *SanitizerRegistry) Add(sanitizers ...Sanitizer) {
+	r.sanitizers = append(r.sanitizers, sanitizers...)
+}
+
+// apply installs every registered Sanitizer against the given recording session.
+func (r *SanitizerRegistry) apply(tp *TestProxyRecorder) error {
+	for _, s := range r.sanitizers {
+		if err := s.register(tp.proxyAddress, tp.recordingID, tp.client); err != nil {
+			return errors.Wrapf(err, "registering sanitizer")
+		}
+	}
+
+	return nil
+}
+
+// addSanitizer POSTs a test-proxy "Admin/AddSanitizer" request of the given kind.
+func addSanitizer(proxyAddress string, recordingID string, client *http.Client, kind string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, proxyAddress+"/Admin/AddSanitizer", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-abstraction-identifier", kind)
+	req.Header.Set(recordingIdHeader, recordingID)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("test-proxy returned %d adding %s sanitizer", resp.StatusCode, kind)
+	}
+
+	return nil
+}
+
+// BodyRegexSanitizer replaces every match of a regular expression in request and
+// response bodies with a fixed value.
+type BodyRegexSanitizer struct {
+	regex string
+	value string
+}
+
+func NewBodyRegexSanitizer(regex string, value string) *BodyRegexSanitizer {
+	return &BodyRegexSanitizer{regex: regex, value: value}
+}
+
+func (s *BodyRegexSanitizer) register(proxyAddress string, recordingID string, client *http.Client) error {
+	return addSanitizer(proxyAddress, recordingID, client, "BodyRegexSanitizer", map[string]string{
+		"regex": s.regex,
+		"value": s.value,
+	})
+}
+
+// BodyKeyReplacer replaces the value found at a JSON path (e.g. "$..primaryKey")
+// in request and response bodies with a fixed value. This is the right tool for
+// secrets that live under a known key but whose value has no recognizable shape.
+//
+// If jsonPath isn't scoped to an unambiguous key on its own (e.g. a generic name like
+// "value" that also shows up in unrelated response shapes), use
+// NewScopedBodyKeyReplacer instead so the rule only fires for the URL it's meant for.
+type BodyKeyReplacer struct {
+	jsonPath string
+	value    string
+	uriRegex string // empty means "applies to every request/response"
+}
+
+func NewBodyKeyReplacer(jsonPath string, value string) *BodyKeyReplacer {
+	return &BodyKeyReplacer{jsonPath: jsonPath, value: value}
+}
+
+// NewScopedBodyKeyReplacer is like NewBodyKeyReplacer, but only applies to requests
+// whose URI matches uriRegex - needed for JSON paths too generic to sanitize everywhere.
+func NewScopedBodyKeyReplacer(jsonPath string, value string, uriRegex string) *BodyKeyReplacer {
+	return &BodyKeyReplacer{jsonPath: jsonPath, value: value, uriRegex: uriRegex}
+}
+
+func (s *BodyKeyReplacer) register(proxyAddress string, recordingID string, client *http.Client) error {
+	body := map[string]interface{}{
+		"jsonPath": s.jsonPath,
+		"value":    s.value,
+	}
+	if s.uriRegex != "" {
+		body["condition"] = map[string]string{"uriRegex": s.uriRegex}
+	}
+
+	return addSanitizer(proxyAddress, recordingID, client, "BodyKeySanitizer", body)
+}
+
+// URIRegexSanitizer replaces every match of a regular expression in the request URI
+// (e.g. a SAS "sig=" token or an embedded subscription/tenant ID) with a fixed value.
+type URIRegexSanitizer struct {
+	regex string
+	value string
+}
+
+func NewURIRegexSanitizer(regex string, value string) *URIRegexSanitizer {
+	return &URIRegexSanitizer{regex: regex, value: value}
+}
+
+func (s *URIRegexSanitizer) register(proxyAddress string, recordingID string, client *http.Client) error {
+	return addSanitizer(proxyAddress, recordingID, client, "UriRegexSanitizer", map[string]string{
+		"regex": s.regex,
+		"value": s.value,
+	})
+}
+
+// HeaderRegexSanitizer replaces every match of a regular expression in the named
+// header's value with a fixed value.
+type HeaderRegexSanitizer struct {
+	header string
+	regex  string
+	value  string
+}
+
+func NewHeaderRegexSanitizer(header string, regex string, value string) *HeaderRegexSanitizer {
+	return &HeaderRegexSanitizer{header: header, regex: regex, value: value}
+}
+
+func (s *HeaderRegexSanitizer) register(proxyAddress string, recordingID string, client *http.Client) error {
+	return addSanitizer(proxyAddress, recordingID, client, "HeaderRegexSanitizer", map[string]string{
+		"key":   s.header,
+		"regex": s.regex,
+		"value": s.value,
+	})
+}
+
+// HeaderRemover strips the named header from both the request and response entirely.
+type HeaderRemover struct {
+	header string
+}
+
+func NewHeaderRemover(header string) *HeaderRemover {
+	return &HeaderRemover{header: header}
+}
+
+func (s *HeaderRemover) register(proxyAddress string, recordingID string, client *http.Client) error {
+	return addSanitizer(proxyAddress, recordingID, client, "HeaderTransform", map[string]string{
+		"key": s.header,
+	})
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyKeyReplacer_Register_OmitsConditionWhenUnscoped(t *testing.T) {
+	t.Parallel()
+
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, r.ContentLength)
+		_, _ = r.Body.Read(buf)
+		gotBody = string(buf)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewBodyKeyReplacer("$..primaryKey", "{KEY}")
+	if err := s.register(server.URL, "rec-id", server.Client()); err != nil {
+		t.Fatalf("register returned error: %s", err)
+	}
+
+	if strings.Contains(gotBody, "condition") {
+		t.Fatalf("expected no condition field for an unscoped replacer, got body: %s", gotBody)
+	}
+}
+
+func TestBodyKeyReplacer_Register_IncludesConditionWhenScoped(t *testing.T) {
+	t.Parallel()
+
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, r.ContentLength)
+		_, _ = r.Body.Read(buf)
+		gotBody = string(buf)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewScopedBodyKeyReplacer("$..value", "{SECRET}", `/secrets/[^/]+$`)
+	if err := s.register(server.URL, "rec-id", server.Client()); err != nil {
+		t.Fatalf("register returned error: %s", err)
+	}
+
+	if !strings.Contains(gotBody, "condition") || !strings.Contains(gotBody, "/secrets/") {
+		t.Fatalf("expected a uriRegex condition scoping the rule, got body: %s", gotBody)
+	}
+}
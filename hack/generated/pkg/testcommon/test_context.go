@@ -6,18 +6,14 @@ Licensed under the MIT license.
 package testcommon
 
 import (
-	"bytes"
-	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
-	"io"
 	"net/http"
-	"regexp"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/Azure/go-autorest/autorest"
-	"github.com/dnaeon/go-vcr/cassette"
 	"github.com/dnaeon/go-vcr/recorder"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
@@ -34,22 +30,40 @@ var (
 	DefaultTestRegion = "westus2" // Could make this an env variable if we wanted
 )
 
+// TestMode selects how a test's Kubernetes side is run.
+type TestMode string
+
+const (
+	// ModeEnvtest runs reconcilers and webhooks against a full etcd+apiserver+webhook
+	// envtest environment. Slower, but exercises CRD validation and webhooks for real.
+	ModeEnvtest = TestMode("envtest")
+	// ModeFake runs reconcilers directly against a controller-runtime fake client.
+	// Sub-second, but doesn't exercise CRD validation or webhooks.
+	ModeFake = TestMode("fake")
+	// ModeLive names a real Kubernetes cluster, e.g. for manual/dev testing.
+	// CreateKubeTestContext does not support it and returns an error for it.
+	ModeLive = TestMode("live")
+)
+
 type TestContext struct {
 	AzureRegion  string
 	NameConfig   *ResourceNameConfig
 	RecordReplay bool
+	Sanitizers   *SanitizerRegistry
+	KubeTestMode TestMode
 }
 
 type PerTestContext struct {
 	TestContext
 	T                   *testing.T
 	logger              logr.Logger
-	AzureClientRecorder *recorder.Recorder
+	AzureClientRecorder *TestProxyRecorder
 	AzureClient         armclient.Applier
 	AzureSubscription   string
 	AzureMatch          *ArmMatcher
 	Namer               ResourceNamer
 	TestName            string
+	randCallCount       *uint64
 }
 
 // If you modify this make sure to modify the cleanup-test-azure-resources target in the Makefile too
@@ -60,6 +74,8 @@ func NewTestContext(region string, recordReplay bool) TestContext {
 		AzureRegion:  region,
 		RecordReplay: recordReplay,
 		NameConfig:   NewResourceNameConfig(ResourcePrefix, "-", 6),
+		Sanitizers:   NewDefaultSanitizerRegistry(),
+		KubeTestMode: ModeEnvtest,
 	}
 }
 
@@ -67,11 +83,19 @@ func (tc TestContext) ForTest(t *testing.T) (PerTestContext, error) {
 	logger := NewTestLogger(t)
 
 	cassetteName := "recordings/" + t.Name()
-	authorizer, subscriptionID, recorder, err := createRecorder(cassetteName, tc.RecordReplay)
+	authorizer, subscriptionID, upstreamBaseURI, testProxyRecorder, err := createRecorder(cassetteName, tc.RecordReplay)
 	if err != nil {
 		return PerTestContext{}, errors.Wrapf(err, "creating recorder")
 	}
 
+	if testProxyRecorder.Mode() != recorder.ModeDisabled {
+		// in disabled mode we talk to Azure directly with no proxy session to register
+		// sanitizers against
+		if err := tc.Sanitizers.apply(testProxyRecorder); err != nil {
+			return PerTestContext{}, errors.Wrapf(err, "registering sanitizers")
+		}
+	}
+
 	armClient, err := armclient.NewAzureTemplateClient(authorizer, subscriptionID)
 	if err != nil {
 		return PerTestContext{}, errors.Wrapf(err, "creating ARM client")
@@ -79,12 +103,13 @@ func (tc TestContext) ForTest(t *testing.T) (PerTestContext, error) {
 
 	// replace the ARM client transport (a bit hacky)
 	httpClient := armClient.RawClient.Sender.(*http.Client)
-	httpClient.Transport = addCountHeader(translateErrors(recorder, cassetteName, t))
+	transport := testProxyRecorder.Transport(httpClient.Transport, upstreamBaseURI)
+	httpClient.Transport = addCountHeader(translateErrors(transport, cassetteName, t))
 
 	t.Cleanup(func() {
 		if !t.Failed() {
 			logger.Info("saving ARM client recorder")
-			err := recorder.Stop()
+			err := testProxyRecorder.Stop()
 			if err != nil {
 				// cleanup function should not error-out
 				logger.Error(err, "unable to stop ARM client recorder")
@@ -93,41 +118,45 @@ func (tc TestContext) ForTest(t *testing.T) (PerTestContext, error) {
 		}
 	})
 
+	randCallCount := new(uint64)
+	randReader := chooseRandReader(testProxyRecorder.Mode(), t.Name(), randCallCount)
+
 	return PerTestContext{
 		TestContext:         tc,
 		T:                   t,
 		logger:              logger,
-		Namer:               tc.NameConfig.NewResourceNamer(t.Name()),
+		Namer:               tc.NameConfig.NewResourceNamer(t.Name(), randReader),
 		AzureClient:         armClient,
 		AzureSubscription:   subscriptionID,
 		AzureMatch:          NewArmMatcher(armClient),
-		AzureClientRecorder: recorder,
+		AzureClientRecorder: testProxyRecorder,
 		TestName:            t.Name(),
+		randCallCount:       randCallCount,
 	}, nil
 }
 
-func createRecorder(cassetteName string, recordReplay bool) (autorest.Authorizer, string, *recorder.Recorder, error) {
-	var err error
-	var r *recorder.Recorder
-	if recordReplay {
-		r, err = recorder.New(cassetteName)
-	} else {
-		r, err = recorder.NewAsMode(cassetteName, recorder.ModeDisabled, nil)
-	}
-
+func createRecorder(cassetteName string, recordReplay bool) (autorest.Authorizer, string, string, *TestProxyRecorder, error) {
+	testProxyRecorder, err := newTestProxyRecorder(cassetteName, recordReplay)
 	if err != nil {
-		return nil, "", nil, errors.Wrapf(err, "creating recorder")
+		return nil, "", "", nil, errors.Wrapf(err, "creating test-proxy recorder")
 	}
 
+	// this is where the proxy should forward requests to when recording
+	upstreamBaseURI := "https://management.azure.com/"
+
 	var authorizer autorest.Authorizer
 	var subscriptionID string
-	if r.Mode() == recorder.ModeRecording ||
-		r.Mode() == recorder.ModeDisabled {
-		// if we are recording, we need auth
+	if testProxyRecorder.Mode() == recorder.ModeRecording ||
+		testProxyRecorder.Mode() == recorder.ModeDisabled {
+		// if we are recording (or talking to Azure directly with no cassette at all),
+		// we need auth
 		authorizer, subscriptionID, err = getAuthorizer()
 		if err != nil {
-			return nil, "", nil, err
+			return nil, "", "", nil, err
 		}
+		// cache the token across test runs so re-recording many cassettes in a row
+		// doesn't re-exchange credentials with AAD for every single one of them
+		authorizer = wrapWithTokenCache(authorizer, os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), upstreamBaseURI)
 	} else {
 		// if we are replaying, we won't need auth
 		// and we use a dummy subscription ID
@@ -135,93 +164,7 @@ func createRecorder(cassetteName string, recordReplay bool) (autorest.Authorizer
 		authorizer = nil
 	}
 
-	// check body as well as URL/Method (copied from go-vcr documentation)
-	r.SetMatcher(func(r *http.Request, i cassette.Request) bool {
-		if !cassette.DefaultMatcher(r, i) {
-			return false
-		}
-
-		// verify custom request count header (see counting_roundtripper.go)
-		if r.Header.Get(COUNT_HEADER) != i.Headers.Get(COUNT_HEADER) {
-			return false
-		}
-
-		if r.Body == nil {
-			return i.Body == ""
-		}
-
-		var b bytes.Buffer
-		if _, err := b.ReadFrom(r.Body); err != nil {
-			panic(err)
-		}
-
-		r.Body = io.NopCloser(&b)
-		return b.String() == "" || hideRecordingData(b.String()) == i.Body
-	})
-
-	r.AddSaveFilter(func(i *cassette.Interaction) error {
-		// rewrite all request/response fields to hide the real subscription ID
-		// this is *not* a security measure but intended to make the tests updateable from
-		// any subscription, so a contributer can update the tests against their own sub
-		hideSubID := func(s string) string {
-			return strings.ReplaceAll(s, subscriptionID, uuid.Nil.String())
-		}
-
-		i.Request.Body = hideRecordingData(hideSubID(i.Request.Body))
-		i.Response.Body = hideRecordingData(hideSubID(i.Response.Body))
-		i.Request.URL = hideSubID(i.Request.URL)
-
-		for _, values := range i.Request.Headers {
-			for i := range values {
-				values[i] = hideSubID(values[i])
-			}
-		}
-
-		for _, values := range i.Response.Headers {
-			for i := range values {
-				values[i] = hideSubID(values[i])
-			}
-		}
-
-		// remove all Authorization headers from stored requests
-		delete(i.Request.Headers, "Authorization")
-
-		// remove all request IDs
-		delete(i.Response.Headers, "X-Ms-Correlation-Request-Id")
-		delete(i.Response.Headers, "X-Ms-Ratelimit-Remaining-Subscription-Reads")
-		delete(i.Response.Headers, "X-Ms-Ratelimit-Remaining-Subscription-Writes")
-		delete(i.Response.Headers, "X-Ms-Request-Id")
-		delete(i.Response.Headers, "X-Ms-Routing-Request-Id")
-
-		// don't need these headers and they add to diff churn
-		delete(i.Request.Headers, "User-Agent")
-		delete(i.Response.Headers, "Date")
-
-		return nil
-	})
-
-	return authorizer, subscriptionID, r, nil
-}
-
-var dateMatcher = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(.\d+)?Z`)
-var sshKeyMatcher = regexp.MustCompile("ssh-rsa [0-9a-zA-Z+/=]+")
-
-// hideDates replaces all ISO8601 datetimes with a fixed value
-// this lets us match requests that may contain time-sensitive information (timestamps, etc)
-func hideDates(s string) string {
-	return dateMatcher.ReplaceAllLiteralString(s, "2001-02-03T04:05:06Z") // this should be recognizable/parseable as a fake date
-}
-
-// hideSSHKeys hides anything that looks like SSH keys
-func hideSSHKeys(s string) string {
-	return sshKeyMatcher.ReplaceAllLiteralString(s, "ssh-rsa {KEY}")
-}
-
-func hideRecordingData(s string) string {
-	result := hideDates(s)
-	result = hideSSHKeys(result)
-
-	return result
+	return authorizer, subscriptionID, upstreamBaseURI, testProxyRecorder, nil
 }
 
 func (tc PerTestContext) NewTestResourceGroup() *resources.ResourceGroup {
@@ -236,14 +179,12 @@ func (tc PerTestContext) NewTestResourceGroup() *resources.ResourceGroup {
 	}
 }
 
-// GenerateSSHKey generates an SSH key.
+// GenerateSSHKey generates an SSH key. When the test is recording or replaying, the key
+// reads its randomness from DeterministicRand(), seeded from the test name. crypto/rsa
+// does not promise the same key for the same random stream, so the key itself can still
+// differ between runs.
 func (tc PerTestContext) GenerateSSHKey(size int) (*string, error) {
-	// Note: If we ever want to make sure that the SSH keys are the same between
-	// test runs, we can base it off of a hash of subscription ID. Right now since
-	// we just replace the SSH key in the recordings regardless of what the value is
-	// there's no need for uniformity between runs though.
-
-	key, err := rsa.GenerateKey(rand.Reader, size)
+	key, err := rsa.GenerateKey(tc.DeterministicRand(), size)
 	if err != nil {
 		return nil, err
 	}
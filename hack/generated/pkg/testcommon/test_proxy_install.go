@@ -0,0 +1,183 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// testProxyDownloadURLEnvVar overrides where the standalone test-proxy release archive
+// is fetched from, e.g. to point at an internal mirror instead of the public release.
+const testProxyDownloadURLEnvVar = "AZURE_TEST_PROXY_DOWNLOAD_URL"
+
+// defaultTestProxyDownloadBaseURL is where the standalone (no-dotnet-required) test-proxy
+// binary is published, one zip per OS/arch. See:
+// https://github.com/Azure/azure-sdk-tools/tree/main/tools/test-proxy/Azure.Sdk.Tools.TestProxy
+const defaultTestProxyDownloadBaseURL = "https://github.com/Azure/azure-sdk-tools/releases/latest/download"
+
+// ensureTestProxyInstalled returns the path to a test-proxy binary, installing one into
+// a local cache under ~/.azure-service-operator/test-proxy if it can't be found on PATH
+// and hasn't already been cached by an earlier run.
+func ensureTestProxyInstalled() (string, error) {
+	if binary, err := exec.LookPath("test-proxy"); err == nil {
+		return binary, nil
+	}
+
+	cacheDir, err := testProxyCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	binaryPath := filepath.Join(cacheDir, testProxyBinaryName())
+	if _, err := os.Stat(binaryPath); err == nil {
+		// already downloaded by a previous run
+		return binaryPath, nil
+	}
+
+	if err := downloadTestProxy(cacheDir); err != nil {
+		return "", errors.Wrapf(err, "auto-installing test-proxy")
+	}
+
+	return binaryPath, nil
+}
+
+func testProxyCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "determining home directory")
+	}
+
+	dir := filepath.Join(home, ".azure-service-operator", "test-proxy")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Wrapf(err, "creating %s", dir)
+	}
+
+	return dir, nil
+}
+
+func testProxyBinaryName() string {
+	if runtime.GOOS == "windows" {
+		return "test-proxy.exe"
+	}
+
+	return "test-proxy"
+}
+
+// testProxyReleaseAsset is the name of the zip archive published for the running OS/arch.
+func testProxyReleaseAsset() (string, error) {
+	var osName string
+	switch runtime.GOOS {
+	case "windows", "linux", "darwin":
+		osName = runtime.GOOS
+	default:
+		return "", errors.Errorf("no published test-proxy release for OS %q", runtime.GOOS)
+	}
+
+	var archName string
+	switch runtime.GOARCH {
+	case "amd64", "arm64":
+		archName = runtime.GOARCH
+	default:
+		return "", errors.Errorf("no published test-proxy release for architecture %q", runtime.GOARCH)
+	}
+
+	return fmt.Sprintf("test-proxy-standalone-%s-%s.zip", osName, archName), nil
+}
+
+// downloadTestProxy fetches the standalone test-proxy release archive and extracts the
+// binary into destDir.
+func downloadTestProxy(destDir string) error {
+	asset, err := testProxyReleaseAsset()
+	if err != nil {
+		return err
+	}
+
+	baseURL := os.Getenv(testProxyDownloadURLEnvVar)
+	if baseURL == "" {
+		baseURL = defaultTestProxyDownloadBaseURL
+	}
+
+	archivePath, err := downloadToTempFile(baseURL + "/" + asset)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archivePath)
+
+	if err := extractBinaryFromZip(archivePath, testProxyBinaryName(), destDir); err != nil {
+		return err
+	}
+
+	return os.Chmod(filepath.Join(destDir, testProxyBinaryName()), 0755)
+}
+
+func downloadToTempFile(url string) (string, error) {
+	resp, err := http.Get(url) //nolint:gosec // url is assembled from a trusted, fixed base plus a known asset name
+	if err != nil {
+		return "", errors.Wrapf(err, "downloading %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("downloading %s returned %d", url, resp.StatusCode)
+	}
+
+	out, err := os.CreateTemp("", "test-proxy-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", errors.Wrapf(err, "saving %s", url)
+	}
+
+	return out.Name(), nil
+}
+
+// extractBinaryFromZip pulls binaryName out of the zip archive at archivePath and writes
+// it into destDir, ignoring any other files the archive contains.
+func extractBinaryFromZip(archivePath string, binaryName string, destDir string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", archivePath)
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if filepath.Base(f.Name) != binaryName {
+			continue
+		}
+
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.OpenFile(filepath.Join(destDir, binaryName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		if _, err := io.Copy(dst, src); err != nil {
+			return errors.Wrapf(err, "extracting %s", binaryName)
+		}
+
+		return nil
+	}
+
+	return errors.Errorf("%s did not contain %s", archivePath, binaryName)
+}
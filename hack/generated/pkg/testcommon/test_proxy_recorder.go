@@ -0,0 +1,249 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/go-vcr/recorder"
+	"github.com/pkg/errors"
+)
+
+// These are the same well-known headers the other Azure SDK test-proxy clients use to
+// talk to the proxy sidecar. See: https://github.com/Azure/azure-sdk-tools/tree/main/tools/test-proxy
+const (
+	recordingModeHeader            = "x-recording-mode"
+	recordingIdHeader              = "x-recording-id"
+	recordingUpstreamBaseUriHeader = "x-recording-upstream-base-uri"
+
+	testProxyAddressEnvVar = "AZURE_TEST_PROXY_ADDRESS"
+	defaultTestProxyPort   = 5000
+)
+
+// TestProxyRecorder talks to the out-of-process Azure test-proxy server instead of
+// recording/playing back requests in-process. It implements the same start/stop
+// lifecycle as the go-vcr recorder it replaces, but the cassette itself lives on
+// the proxy side so it can be shared with the other Azure SDKs.
+type TestProxyRecorder struct {
+	proxyAddress string
+	cassetteName string
+	mode         recorder.Mode
+	recordingID  string
+
+	client *http.Client
+}
+
+// newTestProxyRecorder starts (or resumes) recording/playback of cassetteName against
+// the already-running test-proxy server. When recordReplay is false it returns a
+// recorder in recorder.ModeDisabled instead, meaning "talk to Azure directly, no
+// cassette involved" - used for ad hoc runs against a real subscription.
+func newTestProxyRecorder(cassetteName string, recordReplay bool) (*TestProxyRecorder, error) {
+	if !recordReplay {
+		return &TestProxyRecorder{mode: recorder.ModeDisabled}, nil
+	}
+
+	proxyAddress := os.Getenv(testProxyAddressEnvVar)
+	if proxyAddress == "" {
+		proxyAddress = fmt.Sprintf("http://localhost:%d", defaultTestProxyPort)
+	}
+
+	// match go-vcr's historical behavior: record if the cassette doesn't exist yet,
+	// otherwise replay it
+	mode := recorder.ModeReplaying
+	if _, err := os.Stat(cassetteName + ".json"); os.IsNotExist(err) {
+		mode = recorder.ModeRecording
+	}
+
+	tp := &TestProxyRecorder{
+		proxyAddress: proxyAddress,
+		cassetteName: cassetteName,
+		mode:         mode,
+		client:       &http.Client{},
+	}
+
+	recordingID, err := tp.start()
+	if err != nil {
+		return nil, errors.Wrapf(err, "starting test-proxy recording for %q", cassetteName)
+	}
+	tp.recordingID = recordingID
+
+	return tp, nil
+}
+
+// start tells the proxy to begin recording or playing back tp.cassetteName and
+// returns the recording ID the proxy assigned, which must be sent on every subsequent call.
+func (tp *TestProxyRecorder) start() (string, error) {
+	action := "record/start"
+	if tp.mode == recorder.ModeReplaying {
+		action = "playback/start"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tp.proxyAddress+"/"+action, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("x-recording-file", tp.cassetteName)
+
+	resp, err := tp.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("test-proxy returned %d starting %s for %q", resp.StatusCode, action, tp.cassetteName)
+	}
+
+	recordingID := resp.Header.Get(recordingIdHeader)
+	if recordingID == "" {
+		return "", errors.Errorf("test-proxy did not return a %s header", recordingIdHeader)
+	}
+
+	return recordingID, nil
+}
+
+// Stop tells the proxy to finish recording/playback and flush the cassette to disk.
+// It is a no-op when the recorder is disabled, since no recording session was started.
+func (tp *TestProxyRecorder) Stop() error {
+	if tp.mode == recorder.ModeDisabled {
+		return nil
+	}
+
+	action := "record/stop"
+	if tp.mode == recorder.ModeReplaying {
+		action = "playback/stop"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tp.proxyAddress+"/"+action, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(recordingIdHeader, tp.recordingID)
+
+	resp, err := tp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("test-proxy returned %d stopping %s for %q", resp.StatusCode, action, tp.cassetteName)
+	}
+
+	return nil
+}
+
+// Mode reports whether this recorder is recording or replaying, matching the go-vcr
+// recorder.Mode() that the rest of testcommon already switches on.
+func (tp *TestProxyRecorder) Mode() recorder.Mode {
+	return tp.mode
+}
+
+// Transport returns an http.RoundTripper that routes every ARM call through the proxy,
+// tagging it with the recording ID and the real upstream so the proxy knows where to
+// forward (when recording) or which interaction to play back (when replaying). When the
+// recorder is disabled it returns upstream unmodified, so calls go straight to Azure.
+func (tp *TestProxyRecorder) Transport(upstream http.RoundTripper, upstreamBaseURI string) http.RoundTripper {
+	if tp.mode == recorder.ModeDisabled {
+		return upstream
+	}
+
+	return &testProxyRoundTripper{
+		inner:           upstream,
+		proxyAddress:    tp.proxyAddress,
+		recordingID:     tp.recordingID,
+		mode:            tp.mode,
+		upstreamBaseURI: upstreamBaseURI,
+	}
+}
+
+type testProxyRoundTripper struct {
+	inner           http.RoundTripper
+	proxyAddress    string
+	recordingID     string
+	mode            recorder.Mode
+	upstreamBaseURI string
+}
+
+func (t *testProxyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordingMode := "record"
+	if t.mode == recorder.ModeReplaying {
+		recordingMode = "playback"
+	}
+
+	req.Header.Set(recordingModeHeader, recordingMode)
+	req.Header.Set(recordingIdHeader, t.recordingID)
+	req.Header.Set(recordingUpstreamBaseUriHeader, t.upstreamBaseURI)
+
+	originalURL := req.URL
+	proxyURL, err := req.URL.Parse(t.proxyAddress)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing test-proxy address %q", t.proxyAddress)
+	}
+	proxyURL.Path = originalURL.Path
+	proxyURL.RawQuery = originalURL.RawQuery
+	req.URL = proxyURL
+	req.Host = proxyURL.Host
+
+	return t.inner.RoundTrip(req)
+}
+
+// StartTestProxyForPackage is intended to be called from a package's TestMain so that a
+// single test-proxy instance is shared by every test in the package, started once and
+// torn down once, rather than per-test.
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(testcommon.StartTestProxyForPackage(m))
+//	}
+func StartTestProxyForPackage(m *testing.M) int {
+	shutdown, err := ensureTestProxyRunning()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to start test-proxy: %s\n", err.Error())
+		return 1
+	}
+	defer shutdown()
+
+	return m.Run()
+}
+
+func ensureTestProxyRunning() (func(), error) {
+	if os.Getenv(testProxyAddressEnvVar) != "" {
+		// an external test-proxy instance is already running (e.g. in CI) - nothing to do
+		return func() {}, nil
+	}
+
+	binary, err := ensureTestProxyInstalled()
+	if err != nil {
+		return nil, errors.Wrapf(err, "installing test-proxy")
+	}
+
+	port := defaultTestProxyPort
+	cmd := exec.Command(binary, "start", "--storage-location", ".", "--port", strconv.Itoa(port))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "launching test-proxy")
+	}
+
+	if err := os.Setenv(testProxyAddressEnvVar, fmt.Sprintf("http://localhost:%d", port)); err != nil {
+		return nil, err
+	}
+
+	// give the proxy a moment to come up before the first test hits it
+	time.Sleep(2 * time.Second)
+
+	return func() {
+		_ = cmd.Process.Kill()
+		_ = os.Unsetenv(testProxyAddressEnvVar)
+	}, nil
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/pkg/errors"
+)
+
+// forceRefreshAuthEnvVar, when set to any non-empty value, skips reading the on-disk token
+// cache and forces a fresh AAD token exchange; the fresh token is still written back to
+// the cache. Useful when re-recording a
+// cassette against a tenant/SP whose cached token has gone stale in some way the
+// expiry check can't detect (e.g. the SP's permissions changed).
+const forceRefreshAuthEnvVar = "FORCE_REFRESH_AUTH"
+
+// defaultTokenExpirySkew is how far ahead of a cached token's real expiry we treat it
+// as unusable, to leave headroom for the recording/test run that's about to use it.
+const defaultTokenExpirySkew = 5 * time.Minute
+
+// tokenCachePath returns the path to the persistent token cache file, creating its
+// parent directory if necessary.
+func tokenCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "determining home directory")
+	}
+
+	dir := filepath.Join(home, ".azure-service-operator")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Wrapf(err, "creating %s", dir)
+	}
+
+	return filepath.Join(dir, "test-tokens.json"), nil
+}
+
+// cachedToken is a single tenant+client+resource scoped entry in the token cache.
+type cachedToken struct {
+	AuthorizationHeader string `json:"authorizationHeader"`
+	ExpiresOn           int64  `json:"expiresOn"` // unix seconds
+}
+
+func (c cachedToken) expiry() time.Time {
+	return time.Unix(c.ExpiresOn, 0)
+}
+
+// tokenCacheFile is the on-disk format of the whole cache, keyed by "tenant/client/resource".
+type tokenCacheFile map[string]cachedToken
+
+// tokenCacheFileMu guards every read-modify-write of the on-disk token cache file. A new
+// cachingAuthorizer is created per test, and every generated resource test runs in
+// parallel, so this has to be a package-level lock rather than one scoped to a single
+// authorizer - otherwise concurrent loadTokenCacheFile/saveTokenCacheFile calls against
+// the same path can interleave and corrupt the shared cache for every other test.
+var tokenCacheFileMu sync.Mutex
+
+func loadTokenCacheFile() (tokenCacheFile, error) {
+	path, err := tokenCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tokenCacheFile{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading token cache %s", path)
+	}
+
+	var result tokenCacheFile
+	if err := json.Unmarshal(contents, &result); err != nil {
+		return nil, errors.Wrapf(err, "parsing token cache %s", path)
+	}
+
+	return result, nil
+}
+
+func saveTokenCacheFile(cache tokenCacheFile) error {
+	path, err := tokenCachePath()
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0600)
+}
+
+// PurgeTokenCache deletes the persistent test-token cache. Call this if a cached
+// token turns out to be bad in a way re-recording can't recover from (e.g. the
+// backing service principal was deleted and recreated).
+func PurgeTokenCache() error {
+	path, err := tokenCachePath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "removing token cache %s", path)
+	}
+
+	return nil
+}
+
+// cachingAuthorizer wraps another autorest.Authorizer with a persistent, on-disk cache
+// so that re-recording many cassettes in a row doesn't cost a fresh AAD token exchange
+// per test - something SP/device-code flows can get throttled for.
+type cachingAuthorizer struct {
+	inner    autorest.Authorizer
+	cacheKey string
+	skew     time.Duration
+}
+
+// wrapWithTokenCache caches the bearer tokens that inner produces, keyed by
+// tenant+client+resource, under ~/.azure-service-operator/test-tokens.json.
+func wrapWithTokenCache(inner autorest.Authorizer, tenantID string, clientID string, resource string) autorest.Authorizer {
+	return &cachingAuthorizer{
+		inner:    inner,
+		cacheKey: strings.Join([]string{tenantID, clientID, resource}, "/"),
+		skew:     defaultTokenExpirySkew,
+	}
+}
+
+func (c *cachingAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			header, err := c.authorizationHeader()
+			if err != nil {
+				return nil, err
+			}
+
+			r.Header.Set("Authorization", header)
+			return p.Prepare(r)
+		})
+	}
+}
+
+func (c *cachingAuthorizer) authorizationHeader() (string, error) {
+	tokenCacheFileMu.Lock()
+	defer tokenCacheFileMu.Unlock()
+
+	forceRefresh := os.Getenv(forceRefreshAuthEnvVar) != ""
+
+	if !forceRefresh {
+		cache, err := loadTokenCacheFile()
+		if err != nil {
+			return "", err
+		}
+
+		if entry, ok := cache[c.cacheKey]; ok && time.Until(entry.expiry()) > c.skew {
+			return entry.AuthorizationHeader, nil
+		}
+	}
+
+	header, expiresOn, err := c.fetchFreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	cache, err := loadTokenCacheFile()
+	if err != nil {
+		return "", err
+	}
+	cache[c.cacheKey] = cachedToken{AuthorizationHeader: header, ExpiresOn: expiresOn.Unix()}
+	if err := saveTokenCacheFile(cache); err != nil {
+		return "", err
+	}
+
+	return header, nil
+}
+
+// fetchFreshToken runs the wrapped authorizer's real PrepareDecorator against a throwaway
+// request to obtain a fresh Authorization header, then reads the token's "exp" claim
+// back out of it so we know when the cache entry goes stale.
+func (c *cachingAuthorizer) fetchFreshToken() (string, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://management.azure.com/", nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	prepared, err := autorest.CreatePreparer(c.inner.WithAuthorization()).Prepare(req)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "fetching fresh AAD token")
+	}
+
+	header := prepared.Header.Get("Authorization")
+	if header == "" {
+		return "", time.Time{}, errors.Errorf("authorizer did not set an Authorization header")
+	}
+
+	expiresOn, err := jwtExpiry(header)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return header, expiresOn, nil
+}
+
+// jwtExpiry reads the "exp" claim out of a "Bearer <jwt>" Authorization header.
+func jwtExpiry(authorizationHeader string) (time.Time, error) {
+	token := strings.TrimPrefix(authorizationHeader, "Bearer ")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.Errorf("token is not a well-formed JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "decoding JWT payload")
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, errors.Wrapf(err, "parsing JWT claims")
+	}
+
+	return time.Unix(claims.Exp, 0), nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package testcommon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func makeTestJWT(t *testing.T, exp int64) string {
+	t.Helper()
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+
+	claims, err := json.Marshal(struct {
+		Exp int64 `json:"exp"`
+	}{Exp: exp})
+	if err != nil {
+		t.Fatalf("marshalling claims: %s", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+
+	return header + "." + payload + ".signature"
+}
+
+func TestJwtExpiry_ReadsExpClaim(t *testing.T) {
+	t.Parallel()
+
+	want := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := makeTestJWT(t, want.Unix())
+
+	got, err := jwtExpiry("Bearer " + token)
+	if err != nil {
+		t.Fatalf("jwtExpiry returned error: %s", err)
+	}
+
+	if !got.Equal(want) {
+		t.Fatalf("expected expiry %v, got %v", want, got)
+	}
+}
+
+func TestJwtExpiry_RejectsMalformedToken(t *testing.T) {
+	t.Parallel()
+
+	if _, err := jwtExpiry("Bearer not-a-jwt"); err == nil {
+		t.Fatal("expected an error for a malformed token, got nil")
+	}
+}
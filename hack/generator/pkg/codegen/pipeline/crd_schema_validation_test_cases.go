@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ */
+
+package pipeline
+
+import (
+	"context"
+
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/astmodel"
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/testcases"
+
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// InjectCRDSchemaValidationTests adds a test to every generated resource that
+// marshals a gopter-generated instance, validates it against the resource's CRD
+// schema loaded from config/crd/bases, and asserts round-trip fidelity. This catches
+// schema drift between the generated Go types and the CRD schema shipped alongside them.
+func InjectCRDSchemaValidationTests(idFactory astmodel.IdentifierFactory) Stage {
+
+	return MakeLegacyStage(
+		"crdSchemaValidationTestCases",
+		"Add test cases to verify CRD schema round-trip fidelity",
+		func(ctx context.Context, types astmodel.Types) (astmodel.Types, error) {
+			factory := makeCRDSchemaValidationTestCaseFactory(idFactory)
+			result := make(astmodel.Types)
+			var errs []error
+			for _, d := range types {
+				updated, err := factory.AddTestTo(d)
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					result[updated.Name()] = updated
+				}
+			}
+
+			if len(errs) > 0 {
+				return nil, kerrors.NewAggregate(errs)
+			}
+
+			return result, nil
+		})
+}
+
+type crdSchemaValidationTestCaseFactory struct {
+	visitor   astmodel.TypeVisitor
+	idFactory astmodel.IdentifierFactory
+}
+
+func makeCRDSchemaValidationTestCaseFactory(idFactory astmodel.IdentifierFactory) crdSchemaValidationTestCaseFactory {
+	result := crdSchemaValidationTestCaseFactory{
+		idFactory: idFactory,
+	}
+
+	result.visitor = astmodel.TypeVisitorBuilder{
+		VisitResourceType: result.injectTestCaseIntoResource,
+	}.Build()
+
+	return result
+}
+
+func (s *crdSchemaValidationTestCaseFactory) AddTestTo(def astmodel.TypeDefinition) (astmodel.TypeDefinition, error) {
+	return s.visitor.VisitDefinition(def, def.Name())
+}
+
+func (s *crdSchemaValidationTestCaseFactory) injectTestCaseIntoResource(
+	_ *astmodel.TypeVisitor, resource *astmodel.ResourceType, ctx interface{}) (astmodel.Type, error) {
+	name := ctx.(astmodel.TypeName)
+	testcase := testcases.NewCRDSchemaValidationTestCase(name, resource, s.idFactory)
+	result := resource.WithTestCase(testcase)
+	return result, nil
+}
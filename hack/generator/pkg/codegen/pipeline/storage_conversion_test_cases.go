@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ */
+
+package pipeline
+
+import (
+	"context"
+
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/astmodel"
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/testcases"
+
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// InjectStorageConversionTests adds a test to every resource that has more than one
+// API version. The test fuzzes an instance of one version, ConvertTo()s it to the hub
+// storage version and back, and requires deep equality modulo known lossy fields. This
+// catches conversions that silently drop data as new API versions are added.
+func InjectStorageConversionTests(idFactory astmodel.IdentifierFactory) Stage {
+
+	return MakeLegacyStage(
+		"storageConversionTestCases",
+		"Add test cases to verify lossless storage conversion",
+		func(ctx context.Context, types astmodel.Types) (astmodel.Types, error) {
+			factory := makeStorageConversionTestCaseFactory(types, idFactory)
+			result := make(astmodel.Types)
+			var errs []error
+			for _, d := range types {
+				updated, err := factory.AddTestTo(d)
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					result[updated.Name()] = updated
+				}
+			}
+
+			if len(errs) > 0 {
+				return nil, kerrors.NewAggregate(errs)
+			}
+
+			return result, nil
+		})
+}
+
+type storageConversionTestCaseFactory struct {
+	visitor   astmodel.TypeVisitor
+	types     astmodel.Types
+	idFactory astmodel.IdentifierFactory
+}
+
+func makeStorageConversionTestCaseFactory(types astmodel.Types, idFactory astmodel.IdentifierFactory) storageConversionTestCaseFactory {
+	result := storageConversionTestCaseFactory{
+		types:     types,
+		idFactory: idFactory,
+	}
+
+	result.visitor = astmodel.TypeVisitorBuilder{
+		VisitResourceType: result.injectTestCaseIntoResource,
+	}.Build()
+
+	return result
+}
+
+func (s *storageConversionTestCaseFactory) AddTestTo(def astmodel.TypeDefinition) (astmodel.TypeDefinition, error) {
+	return s.visitor.VisitDefinition(def, def.Name())
+}
+
+func (s *storageConversionTestCaseFactory) injectTestCaseIntoResource(
+	_ *astmodel.TypeVisitor, resource *astmodel.ResourceType, ctx interface{}) (astmodel.Type, error) {
+	name := ctx.(astmodel.TypeName)
+
+	// NewStorageConversionTestCase returns nil when the resource only has a single API
+	// version - there's no conversion to round-trip in that case.
+	testcase := testcases.NewStorageConversionTestCase(name, resource, s.types, s.idFactory)
+	if testcase == nil {
+		return resource, nil
+	}
+
+	result := resource.WithTestCase(testcase)
+	return result, nil
+}
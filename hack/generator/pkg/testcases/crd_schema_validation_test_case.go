@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ */
+
+package testcases
+
+import (
+	"fmt"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/pkg/errors"
+
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/astmodel"
+)
+
+// CRDSchemaValidationTestCase generates a test that marshals a gopter-generated
+// instance of a resource to JSON, validates it against the resource's CRD schema
+// loaded from config/crd/bases, and asserts round-trip fidelity. This catches drift
+// between the generated Go type and the CRD schema shipped alongside it.
+type CRDSchemaValidationTestCase struct {
+	testName  string
+	subject   astmodel.TypeName
+	idFactory astmodel.IdentifierFactory
+}
+
+// NewCRDSchemaValidationTestCase creates a new CRDSchemaValidationTestCase for the
+// given resource.
+func NewCRDSchemaValidationTestCase(
+	name astmodel.TypeName,
+	resource *astmodel.ResourceType,
+	idFactory astmodel.IdentifierFactory) *CRDSchemaValidationTestCase {
+	return &CRDSchemaValidationTestCase{
+		testName:  "CRDSchemaValidation",
+		subject:   name,
+		idFactory: idFactory,
+	}
+}
+
+var _ astmodel.TestCase = &CRDSchemaValidationTestCase{}
+
+// Name returns the unique name of this test case.
+func (c *CRDSchemaValidationTestCase) Name() string {
+	return c.testName
+}
+
+// References returns the set of types referenced by this test case.
+func (c *CRDSchemaValidationTestCase) References() astmodel.TypeNameSet {
+	return astmodel.NewTypeNameSet(c.subject)
+}
+
+// Equals determines whether this test case is equal to another one.
+func (c *CRDSchemaValidationTestCase) Equals(other astmodel.TestCase) bool {
+	o, ok := other.(*CRDSchemaValidationTestCase)
+	if !ok {
+		return false
+	}
+
+	return c.testName == o.testName && c.subject.Equals(o.subject)
+}
+
+// AsFuncs renders this test case as a Go test function asserting that a
+// gopter-generated instance round-trips through the CRD schema without data loss.
+func (c *CRDSchemaValidationTestCase) AsFuncs(name astmodel.TypeName, genContext *astmodel.CodeGenerationContext) []dst.Decl {
+	funcName := c.idFactory.CreateIdentifier(
+		fmt.Sprintf("Test_%s_CRDSchemaValidation", name.Name()),
+		astmodel.Exported)
+
+	source := fmt.Sprintf(`
+package fake
+
+func %[1]s(t *testing.T) {
+	t.Parallel()
+	runner := gopter.NewRunner()
+	runner.TestingRun(t)
+
+	properties := gopter.NewProperties(runner.GetParameters())
+	properties.Property(
+		"Round trip through CRD schema",
+		prop.ForAll(Run%[1]sCRDSchemaValidationTestCase, %[2]sGenerator()))
+
+	properties.TestingRun(t)
+}
+
+func Run%[1]sCRDSchemaValidationTestCase(subject %[2]s) string {
+	bin, err := json.Marshal(subject)
+	if err != nil {
+		return err.Error()
+	}
+
+	schema, err := testcommon.LoadCRDSchema(%[3]q)
+	if err != nil {
+		return err.Error()
+	}
+
+	if err := schema.Validate(bin); err != nil {
+		return err.Error()
+	}
+
+	var actual %[2]s
+	if err := json.Unmarshal(bin, &actual); err != nil {
+		return err.Error()
+	}
+
+	if !cmp.Equal(subject, actual, cmpopts.EquateEmpty()) {
+		return cmp.Diff(subject, actual, cmpopts.EquateEmpty())
+	}
+
+	return ""
+}
+`, funcName, name.Name(), crdSchemaFileName(name))
+
+	decl, err := parseTestFunc(source, funcName)
+	if err != nil {
+		// this is a codegen bug, not a user-facing error - panicking here matches the
+		// other test-case generators, which all treat a template failure as fatal
+		panic(errors.Wrapf(err, "generating CRD schema validation test for %s", name))
+	}
+
+	return []dst.Decl{decl}
+}
+
+func crdSchemaFileName(name astmodel.TypeName) string {
+	return fmt.Sprintf("../../config/crd/bases/%s.yaml", name.Name())
+}
+
+// parseTestFunc parses a single generated test function out of source, returning its
+// *dst.FuncDecl so it can be spliced into the generated file alongside the rest of the
+// type's declarations.
+func parseTestFunc(source string, funcName string) (*dst.FuncDecl, error) {
+	file, err := decorator.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range file.Decls {
+		if fn, ok := d.(*dst.FuncDecl); ok && fn.Name.Name == funcName {
+			return fn, nil
+		}
+	}
+
+	return nil, errors.Errorf("generated source did not contain a func named %s", funcName)
+}
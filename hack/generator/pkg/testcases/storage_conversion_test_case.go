@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ */
+
+package testcases
+
+import (
+	"fmt"
+
+	"github.com/dave/dst"
+	"github.com/pkg/errors"
+
+	"github.com/Azure/azure-service-operator/hack/generator/pkg/astmodel"
+)
+
+// StorageConversionTestCase generates a test that fuzzes an instance of one API
+// version, ConvertTo()s it to the hub storage version and ConvertFrom()s it back, and
+// requires deep equality modulo known lossy fields. This catches conversions that
+// silently drop data as new API versions are added.
+type StorageConversionTestCase struct {
+	testName string
+	subject  astmodel.TypeName
+	hub      astmodel.TypeName
+
+	idFactory astmodel.IdentifierFactory
+}
+
+// NewStorageConversionTestCase creates a new StorageConversionTestCase for the given
+// resource, or returns nil if the resource doesn't have more than one API version -
+// there's no conversion to round-trip in that case.
+func NewStorageConversionTestCase(
+	name astmodel.TypeName,
+	resource *astmodel.ResourceType,
+	types astmodel.Types,
+	idFactory astmodel.IdentifierFactory) *StorageConversionTestCase {
+	hub, ok := findHubVersion(name, types)
+	if !ok {
+		return nil
+	}
+
+	return &StorageConversionTestCase{
+		testName:  "StorageConversion",
+		subject:   name,
+		hub:       hub,
+		idFactory: idFactory,
+	}
+}
+
+// findHubVersion looks for another ResourceType in types with the same unqualified name
+// but a different package, and uses it as the hub. It does not check whether that type is
+// marked as the storage version; when several candidates match, which one is returned
+// depends on map iteration order. It returns false if name is the only version of this
+// resource in types.
+func findHubVersion(name astmodel.TypeName, types astmodel.Types) (astmodel.TypeName, bool) {
+	var hub astmodel.TypeName
+	found := false
+
+	for candidateName, candidateDef := range types {
+		if candidateName.Name() != name.Name() || candidateName.Equals(name) {
+			continue
+		}
+
+		if _, ok := candidateDef.Type().(*astmodel.ResourceType); !ok {
+			continue
+		}
+
+		hub = candidateName
+		found = true
+	}
+
+	return hub, found
+}
+
+var _ astmodel.TestCase = &StorageConversionTestCase{}
+
+// Name returns the unique name of this test case.
+func (c *StorageConversionTestCase) Name() string {
+	return c.testName
+}
+
+// References returns the set of types referenced by this test case.
+func (c *StorageConversionTestCase) References() astmodel.TypeNameSet {
+	return astmodel.NewTypeNameSet(c.subject, c.hub)
+}
+
+// Equals determines whether this test case is equal to another one.
+func (c *StorageConversionTestCase) Equals(other astmodel.TestCase) bool {
+	o, ok := other.(*StorageConversionTestCase)
+	if !ok {
+		return false
+	}
+
+	return c.testName == o.testName && c.subject.Equals(o.subject) && c.hub.Equals(o.hub)
+}
+
+// AsFuncs renders this test case as a Go test function asserting that a fuzzed instance
+// of c.subject round-trips losslessly through c.hub and back.
+func (c *StorageConversionTestCase) AsFuncs(name astmodel.TypeName, genContext *astmodel.CodeGenerationContext) []dst.Decl {
+	funcName := c.idFactory.CreateIdentifier(
+		fmt.Sprintf("Test_%s_StorageConversion", name.Name()),
+		astmodel.Exported)
+
+	// c.hub lives in a different package than the subject (it's the storage/hub version
+	// of a different API version) - it must be referenced package-qualified, not by its
+	// bare name, or the generated source either fails to compile or silently resolves to
+	// a same-named symbol in the subject's own package.
+	hubPackage := genContext.MustGetImportedPackageName(c.hub.PackageReference())
+	hubTypeRef := fmt.Sprintf("%s.%s", hubPackage, c.hub.Name())
+
+	source := fmt.Sprintf(`
+package fake
+
+func %[1]s(t *testing.T) {
+	t.Parallel()
+	runner := gopter.NewRunner()
+	runner.TestingRun(t)
+
+	properties := gopter.NewProperties(runner.GetParameters())
+	properties.Property(
+		"Round trip through hub storage version",
+		prop.ForAll(Run%[1]sStorageConversionTestCase, %[2]sGenerator()))
+
+	properties.TestingRun(t)
+}
+
+func Run%[1]sStorageConversionTestCase(subject %[2]s) string {
+	var hub %[3]s
+
+	if err := subject.ConvertTo(&hub); err != nil {
+		return err.Error()
+	}
+
+	var actual %[2]s
+	if err := actual.ConvertFrom(&hub); err != nil {
+		return err.Error()
+	}
+
+	actual.Status = subject.Status
+	if !cmp.Equal(subject, actual, cmpopts.EquateEmpty()) {
+		return cmp.Diff(subject, actual, cmpopts.EquateEmpty())
+	}
+
+	return ""
+}
+`, funcName, name.Name(), hubTypeRef)
+
+	decl, err := parseTestFunc(source, funcName)
+	if err != nil {
+		panic(errors.Wrapf(err, "generating storage conversion test for %s", name))
+	}
+
+	return []dst.Decl{decl}
+}